@@ -0,0 +1,301 @@
+// Copyright (c) 2014 Conformal Systems LLC.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package btcwire
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/h00gs/btcwire/chainhash"
+)
+
+// auxPowVersionBit is the block version bit that, when set, indicates a
+// block header carries an auxiliary proof-of-work payload in addition to
+// its own.  Vanilla bitcoin blocks never set this bit, so they round-trip
+// through readBlockHeader/writeBlockHeader unchanged.
+const auxPowVersionBit = 0x100
+
+// auxPowMagic is the marker merge-mining places in the parent chain's
+// coinbase scriptSig immediately before the committed auxiliary merkle
+// root, merkle tree size, and nonce.
+var auxPowMagic = []byte{0xfa, 0xbe, 'm', 'm'}
+
+// maxAuxPowBranchLength is the maximum number of hashes allowed in either
+// leg of an aux pow merkle branch.  31 levels covers more than two billion
+// leaves, far beyond anything a real merge-mining proof needs; it also
+// keeps 1<<merkleHeight representable in a uint32 so the index math below
+// can neither divide by zero nor silently overflow to it, and bounds the
+// allocation readHashBranch performs for an attacker-supplied count.
+const maxAuxPowBranchLength = 31
+
+// AuxPowHeader carries the merged-mining proof that ties an auxiliary chain
+// block to one that was actually mined on a parent chain.  It is only
+// present on a BlockHeader when auxPowVersionBit is set in Version.
+type AuxPowHeader struct {
+	// CoinbaseTx is the parent chain's coinbase transaction, whose
+	// scriptSig commits to the auxiliary block hash via AuxBranch.
+	CoinbaseTx *MsgTx
+
+	// CoinbaseBranch is the merkle branch connecting CoinbaseTx to the
+	// parent block's merkle root.
+	CoinbaseBranch []chainhash.Hash
+
+	// CoinbaseIndex is CoinbaseTx's position in the parent block's
+	// merkle tree.
+	CoinbaseIndex uint32
+
+	// AuxBranch is the merkle branch connecting the auxiliary block hash
+	// to the root committed in CoinbaseTx's scriptSig.
+	AuxBranch []chainhash.Hash
+
+	// AuxIndex is the auxiliary block's position in the auxiliary merkle
+	// tree, used to choose the chain's slot when more than one auxiliary
+	// chain is merge mined in the same parent block.
+	AuxIndex uint32
+
+	// ParentBlock is the parent chain block header that was actually
+	// mined and whose proof of work is being reused.
+	ParentBlock BlockHeader
+}
+
+// HasAuxPow returns whether the header's version indicates an AuxPowHeader
+// payload follows the core 80-byte header on the wire.
+func (h *BlockHeader) HasAuxPow() bool {
+	return h.Version&auxPowVersionBit != 0
+}
+
+// ReadAuxPowHeader reads an auxiliary proof-of-work payload from r.
+func ReadAuxPowHeader(r io.Reader, pver uint32) (*AuxPowHeader, error) {
+	ap := AuxPowHeader{CoinbaseTx: &MsgTx{}}
+	if err := ap.CoinbaseTx.BtcDecode(r, pver); err != nil {
+		return nil, err
+	}
+
+	branch, err := readHashBranch(r, pver)
+	if err != nil {
+		return nil, err
+	}
+	ap.CoinbaseBranch = branch
+
+	if err := readElement(r, &ap.CoinbaseIndex); err != nil {
+		return nil, err
+	}
+
+	branch, err = readHashBranch(r, pver)
+	if err != nil {
+		return nil, err
+	}
+	ap.AuxBranch = branch
+
+	if err := readElement(r, &ap.AuxIndex); err != nil {
+		return nil, err
+	}
+
+	if err := readBlockHeader(r, pver, &ap.ParentBlock); err != nil {
+		return nil, err
+	}
+
+	return &ap, nil
+}
+
+// WriteAuxPowHeader writes an auxiliary proof-of-work payload to w.
+func WriteAuxPowHeader(w io.Writer, pver uint32, ap *AuxPowHeader) error {
+	if err := ap.CoinbaseTx.BtcEncode(w, pver); err != nil {
+		return err
+	}
+	if err := writeHashBranch(w, pver, ap.CoinbaseBranch); err != nil {
+		return err
+	}
+	if err := writeElement(w, ap.CoinbaseIndex); err != nil {
+		return err
+	}
+	if err := writeHashBranch(w, pver, ap.AuxBranch); err != nil {
+		return err
+	}
+	if err := writeElement(w, ap.AuxIndex); err != nil {
+		return err
+	}
+	return writeBlockHeader(w, pver, &ap.ParentBlock)
+}
+
+// readHashBranch reads a varint-prefixed list of hashes making up one leg of
+// a merkle branch.
+func readHashBranch(r io.Reader, pver uint32) ([]chainhash.Hash, error) {
+	count, err := readVarInt(r, pver)
+	if err != nil {
+		return nil, err
+	}
+	if count > maxAuxPowBranchLength {
+		return nil, fmt.Errorf("aux pow merkle branch length %d exceeds "+
+			"max allowed of %d", count, maxAuxPowBranchLength)
+	}
+
+	branch := make([]chainhash.Hash, count)
+	for i := range branch {
+		if err := readElement(r, &branch[i]); err != nil {
+			return nil, err
+		}
+	}
+	return branch, nil
+}
+
+// writeHashBranch writes a varint-prefixed list of hashes making up one leg
+// of a merkle branch.
+func writeHashBranch(w io.Writer, pver uint32, branch []chainhash.Hash) error {
+	if err := writeVarInt(w, pver, uint64(len(branch))); err != nil {
+		return err
+	}
+	for _, hash := range branch {
+		if err := writeElement(w, hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// calcMerkleBranch applies a merkle branch to leaf, using index to decide,
+// bit by bit, whether each sibling hash is concatenated on the left or the
+// right, and returns the resulting root.
+func calcMerkleBranch(leaf chainhash.Hash, branch []chainhash.Hash, index uint32) chainhash.Hash {
+	hash := leaf
+	for _, sibling := range branch {
+		var buf [2 * chainhash.HashSize]byte
+		if index&1 == 1 {
+			copy(buf[:chainhash.HashSize], sibling[:])
+			copy(buf[chainhash.HashSize:], hash[:])
+		} else {
+			copy(buf[:chainhash.HashSize], hash[:])
+			copy(buf[chainhash.HashSize:], sibling[:])
+		}
+		hash = chainhash.DoubleHashH(buf[:])
+		index >>= 1
+	}
+	return hash
+}
+
+// VerifyAuxPow validates that h's auxiliary proof of work legitimately
+// commits to auxHash, the identifier of the auxiliary chain block being
+// merge mined under chainID.  It checks that the coinbase merkle branch
+// reconstructs the parent block's merkle root, that the auxiliary merkle
+// branch reconstructs the aux root committed in the coinbase's
+// merge-mining magic, and that the parent header's hash meets the
+// difficulty target encoded by h.Bits.
+func (h *BlockHeader) VerifyAuxPow(chainID uint32, auxHash chainhash.Hash) error {
+	if !h.HasAuxPow() {
+		return fmt.Errorf("block header does not carry an auxiliary proof of work")
+	}
+	ap := h.AuxPow
+	if ap == nil {
+		return fmt.Errorf("auxpow version bit set but AuxPow is nil")
+	}
+
+	var buf bytes.Buffer
+	if err := ap.CoinbaseTx.BtcEncode(&buf, 0); err != nil {
+		return err
+	}
+	coinbaseHash := chainhash.DoubleHashH(buf.Bytes())
+	if ap.CoinbaseIndex != 0 {
+		return fmt.Errorf("aux pow coinbase is not the parent block's generation transaction")
+	}
+	root := calcMerkleBranch(coinbaseHash, ap.CoinbaseBranch, ap.CoinbaseIndex)
+	if root != ap.ParentBlock.MerkleRoot {
+		return fmt.Errorf("aux pow coinbase branch does not match parent merkle root")
+	}
+
+	if len(ap.CoinbaseTx.TxIn) == 0 {
+		return fmt.Errorf("aux pow coinbase transaction has no inputs")
+	}
+	script := ap.CoinbaseTx.TxIn[0].SignatureScript
+	magicIdx := bytes.Index(script, auxPowMagic)
+	if magicIdx == -1 {
+		return fmt.Errorf("merge-mining magic not found in coinbase scriptSig")
+	}
+	committed := magicIdx + len(auxPowMagic)
+	if committed+chainhash.HashSize+8 > len(script) {
+		return fmt.Errorf("coinbase scriptSig truncated after merge-mining magic")
+	}
+	var committedAuxRoot chainhash.Hash
+	copy(committedAuxRoot[:], script[committed:committed+chainhash.HashSize])
+	merkleSize := binary.LittleEndian.Uint32(script[committed+chainhash.HashSize : committed+chainhash.HashSize+4])
+	nonce := binary.LittleEndian.Uint32(script[committed+chainhash.HashSize+4 : committed+chainhash.HashSize+8])
+
+	merkleHeight := uint(len(ap.AuxBranch))
+	if merkleHeight > maxAuxPowBranchLength {
+		return fmt.Errorf("aux merkle branch length %d exceeds max allowed of %d",
+			merkleHeight, maxAuxPowBranchLength)
+	}
+	if merkleSize != 1<<merkleHeight {
+		return fmt.Errorf("merge-mining merkle size does not match the aux branch length")
+	}
+	if expected := expectedMerkleIndex(nonce, chainID, merkleHeight); ap.AuxIndex != expected {
+		return fmt.Errorf("aux index %d does not match the slot %d expected for chain id %d",
+			ap.AuxIndex, expected, chainID)
+	}
+
+	auxRoot := calcMerkleBranch(auxHash, ap.AuxBranch, ap.AuxIndex)
+	if auxRoot != committedAuxRoot {
+		return fmt.Errorf("aux merkle branch does not reconstruct the committed aux root")
+	}
+
+	parentHash := ap.ParentBlock.BlockHash()
+	if !checkProofOfWork(parentHash, h.Bits) {
+		return fmt.Errorf("parent block does not meet the auxiliary chain's difficulty target")
+	}
+
+	return nil
+}
+
+// expectedMerkleIndex derives the pseudo-random slot a chain with the given
+// chainID must occupy in an aux merkle tree of the given height, given the
+// nonce committed alongside the aux root in the parent coinbase.  This
+// mirrors the scheme used by merge-mining so that the same parent coinbase
+// cannot be replayed to claim a different chain's slot.
+func expectedMerkleIndex(nonce, chainID uint32, merkleHeight uint) uint32 {
+	rand := nonce
+	rand = rand*1103515245 + 12345
+	rand += chainID
+	rand = rand*1103515245 + 12345
+	return rand % (1 << merkleHeight)
+}
+
+// checkProofOfWork reports whether hash, interpreted as a 256-bit number in
+// little-endian order, is less than or equal to the difficulty target
+// encoded by bits.
+func checkProofOfWork(hash chainhash.Hash, bits uint32) bool {
+	target := compactToBig(bits)
+	if target.Sign() <= 0 {
+		return false
+	}
+
+	hashNum := new(big.Int)
+	reversed := make([]byte, chainhash.HashSize)
+	for i, b := range hash[:] {
+		reversed[chainhash.HashSize-1-i] = b
+	}
+	hashNum.SetBytes(reversed)
+
+	return hashNum.Cmp(target) <= 0
+}
+
+// compactToBig converts a compact representation of a target difficulty,
+// as used in the Bits field of a block header, into a big.Int.
+func compactToBig(compact uint32) *big.Int {
+	mantissa := compact & 0x007fffff
+	exponent := uint(compact >> 24)
+
+	var bn *big.Int
+	if exponent <= 3 {
+		mantissa >>= 8 * (3 - exponent)
+		bn = big.NewInt(int64(mantissa))
+	} else {
+		bn = big.NewInt(int64(mantissa))
+		bn.Lsh(bn, 8*(exponent-3))
+	}
+
+	return bn
+}
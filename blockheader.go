@@ -8,14 +8,16 @@ import (
 	"bytes"
 	"io"
 	"time"
+
+	"github.com/h00gs/btcwire/chainhash"
 )
 
 // BlockVersion is the current latest supported block version.
 const BlockVersion uint32 = 2
 
 // Version 4 bytes + Timestamp 4 bytes + Bits 4 bytes + Nonce 4 bytes +
-// TxnCount (varInt) + PrevBlock and MerkleRoot hashes.
-const maxBlockHeaderPayload = 16 + maxVarIntPayload + (HashSize * 2)
+// PrevBlock and MerkleRoot hashes.
+const maxBlockHeaderPayload = 16 + (chainhash.HashSize * 2)
 
 // BlockHeader defines information about a block and is used in the bitcoin
 // block (MsgBlock) and headers (MsgHeaders) messages.
@@ -24,10 +26,10 @@ type BlockHeader struct {
 	Version uint32
 
 	// Hash of the previous block in the block chain.
-	PrevBlock ShaHash
+	PrevBlock chainhash.Hash
 
 	// Merkle tree reference to hash of all transactions for the block.
-	MerkleRoot ShaHash
+	MerkleRoot chainhash.Hash
 
 	// Time the block was created.  This is, unfortunately, encoded as a
 	// uint32 on the wire and therefore is limited to 2106.
@@ -39,37 +41,40 @@ type BlockHeader struct {
 	// Nonce used to generate the block.
 	Nonce uint32
 
-	// Number of transactions in the block.  For the bitcoin headers
-	// (MsgHeaders) message, this must be 0.  This is encoded as a variable
-	// length integer on the wire.
-	TxnCount uint64
+	// AuxPow is the merged-mining proof tying this header to a block
+	// actually mined on a parent chain.  It is only present when Version
+	// has auxPowVersionBit set and is never part of the core 80-byte
+	// header encoded by Serialize/Deserialize or hashed by BlockHash;
+	// callers that need it read it with ReadAuxPowHeader immediately
+	// after the core header on the wire.
+	AuxPow *AuxPowHeader
 }
 
-// blockHashLen is a constant that represents how much of the block header is
-// used when computing the block sha 0:blockHashLen
-const blockHashLen = 80
+// BlockHashFunc is the hash function used to derive a block's identifier
+// from its serialized header.  It defaults to the bitcoin double SHA-256,
+// but chains that reuse this wire package for their block framing while
+// using a different proof-of-work or identifier hash (scrypt, blake2, ...)
+// can repoint it at the start of the program.
+var BlockHashFunc chainhash.HashFunc = chainhash.DoubleHashH
 
-// BlockSha computes the block identifier hash for the given block header.
-func (h *BlockHeader) BlockSha(pver uint32) (sha ShaHash, err error) {
+// BlockHash computes the block identifier hash for the given block header
+// using BlockHashFunc.
+func (h *BlockHeader) BlockHash() chainhash.Hash {
 	var buf bytes.Buffer
-	err = writeBlockHeader(&buf, pver, h)
-	if err != nil {
-		return
-	}
 
-	err = sha.SetBytes(DoubleSha256(buf.Bytes()[0:blockHashLen]))
-	if err != nil {
-		return
-	}
+	// Encode the header and hash it.  Ignore the error returns since there
+	// is no way the encode could fail except being out of memory which
+	// would cause a run-time panic.
+	_ = h.Serialize(&buf)
 
-	return
+	return BlockHashFunc(buf.Bytes())
 }
 
 // NewBlockHeader returns a new BlockHeader using the provided previous block
 // hash, merkle root hash, difficulty bits, and nonce used to generate the
 // block with defaults for the remaining fields.
-func NewBlockHeader(prevHash *ShaHash, merkleRootHash *ShaHash, bits uint32,
-	nonce uint32) *BlockHeader {
+func NewBlockHeader(prevHash *chainhash.Hash, merkleRootHash *chainhash.Hash,
+	bits uint32, nonce uint32) *BlockHeader {
 
 	return &BlockHeader{
 		Version:    BlockVersion,
@@ -78,11 +83,12 @@ func NewBlockHeader(prevHash *ShaHash, merkleRootHash *ShaHash, bits uint32,
 		Timestamp:  time.Now(),
 		Bits:       bits,
 		Nonce:      nonce,
-		TxnCount:   0,
 	}
 }
 
-// readBlockHeader reads a bitcoin block header from r.
+// readBlockHeader reads a bitcoin block header from r.  See Deserialize for
+// decoding block headers stored to disk, such as in a database, as opposed
+// to decoding block headers from the wire.
 func readBlockHeader(r io.Reader, pver uint32, bh *BlockHeader) error {
 	var sec uint32
 	err := readElements(r, &bh.Version, &bh.PrevBlock, &bh.MerkleRoot, &sec,
@@ -92,28 +98,49 @@ func readBlockHeader(r io.Reader, pver uint32, bh *BlockHeader) error {
 	}
 	bh.Timestamp = time.Unix(int64(sec), 0)
 
-	count, err := readVarInt(r, pver)
-	if err != nil {
-		return err
-	}
-	bh.TxnCount = count
-
 	return nil
 }
 
-// writeBlockHeader writes a bitcoin block header to w.
+// writeBlockHeader writes a bitcoin block header to w.  See Serialize for
+// encoding block headers to be stored to disk, such as in a database, as
+// opposed to encoding block headers for the wire.
 func writeBlockHeader(w io.Writer, pver uint32, bh *BlockHeader) error {
 	sec := uint32(bh.Timestamp.Unix())
-	err := writeElements(w, bh.Version, bh.PrevBlock, bh.MerkleRoot,
+	return writeElements(w, bh.Version, bh.PrevBlock, bh.MerkleRoot,
 		sec, bh.Bits, bh.Nonce)
-	if err != nil {
-		return err
-	}
+}
 
-	err = writeVarInt(w, pver, bh.TxnCount)
-	if err != nil {
-		return err
-	}
+// Deserialize decodes a block header from r into the receiver using a format
+// that is suitable for long-term storage such as a database while respecting
+// the Version field.  This function differs from readBlockHeader in that
+// readBlockHeader decodes from the bitcoin wire protocol as it was sent across the network.
+// The wire encoding can technically differ depending on the protocol version
+// and doesn't even really need to match the format of a stored block header
+// at all.  As of the time this comment was written, the encoded block header
+// is the same in both instances, but there is a distinct difference and
+// separating the two allows the API to be flexible enough to deal with
+// changes.
+func (h *BlockHeader) Deserialize(r io.Reader) error {
+	// At the current time, there is no difference between the wire encoding
+	// and the stable long-term storage format.  As a result, make use of
+	// readBlockHeader.
+	return readBlockHeader(r, 0, h)
+}
 
-	return nil
+// Serialize encodes the receiver to w using a format that is suitable for
+// long-term storage such as a database while respecting the Version field.
+// This function differs from writeBlockHeader in that writeBlockHeader
+// encodes to the
+// bitcoin wire protocol in order for the message to be sent across the
+// network.  The wire encoding can technically differ depending on
+// the protocol version and doesn't even really need to match the format of
+// a stored block header at all.  As of the time this comment was written,
+// the encoded block header is the same in both instances, but there is a
+// distinct difference and separating the two allows the API to be flexible
+// enough to deal with changes.
+func (h *BlockHeader) Serialize(w io.Writer) error {
+	// At the current time, there is no difference between the wire encoding
+	// and the stable long-term storage format.  As a result, make use of
+	// writeBlockHeader.
+	return writeBlockHeader(w, 0, h)
 }
@@ -0,0 +1,106 @@
+// Copyright (c) 2013-2015 Conformal Systems LLC.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package btcwire
+
+import (
+	"github.com/h00gs/btcwire/chainhash"
+)
+
+// BlockLocator is used to help locate a specific block.  The algorithm for
+// building the block locator is to add the hashes in reverse order until
+// the genesis block is reached.  In order to keep the list of locator hashes
+// to a reasonable number of entries, first the most recent previous 10 block
+// hashes are added, then the step is doubled each loop iteration to
+// exponentially decrease the number of hashes as a function of the distance
+// from the block being located.
+//
+// For example, assume a block chain with a side chain as depicted below:
+// 	genesis -> 1 -> 2 -> ... -> 15 -> 16  -> 17  -> 18
+// 	                              \-> 16a -> 17a
+//
+// The block locator for block 17a would be the hashes of blocks:
+// [17a 16a 15 14 13 12 11 10 9 8 6 2 genesis]
+type BlockLocator []*chainhash.Hash
+
+// BuildLocator constructs a BlockLocator for tip by walking backwards through
+// the header chain via getHeader, which must return the header for a given
+// hash along with the hash of its parent.  The returned locator always ends
+// with the genesis hash (identified by a zero PrevBlock) regardless of how
+// many steps were taken to reach it.
+func BuildLocator(getHeader func(chainhash.Hash) (*BlockHeader, chainhash.Hash, error),
+	tip chainhash.Hash) (BlockLocator, error) {
+
+	var locator BlockLocator
+	var genesis chainhash.Hash
+
+	hash := tip
+	step := int32(1)
+	for {
+		locatorHash := hash
+		locator = append(locator, &locatorHash)
+
+		header, prevHash, err := getHeader(hash)
+		if err != nil {
+			return nil, err
+		}
+
+		// The genesis block has no parent, and it is always the final
+		// entry in the locator.
+		if header.PrevBlock == genesis {
+			break
+		}
+		hash = prevHash
+
+		// Double the step once the locator has accumulated its first
+		// ten entries so the number of hashes grows logarithmically
+		// with the distance back to the genesis block.
+		if len(locator) >= 10 {
+			step *= 2
+		}
+
+		// Walk back the remainder of the current step so the next
+		// hash added to the locator is the requisite number of
+		// headers behind the previous one.
+		for i := int32(1); i < step; i++ {
+			header, prevHash, err = getHeader(hash)
+			if err != nil {
+				return nil, err
+			}
+			if header.PrevBlock == genesis {
+				locator = append(locator, &hash)
+				return locator, nil
+			}
+			hash = prevHash
+		}
+	}
+
+	return locator, nil
+}
+
+// NewMsgGetBlocks returns a new getblocks message populated with the block
+// locator and stop hash.
+func NewMsgGetBlocks(locator BlockLocator, stopHash *chainhash.Hash) *MsgGetBlocks {
+	msg := &MsgGetBlocks{
+		ProtocolVersion:    ProtocolVersion,
+		BlockLocatorHashes: []*chainhash.Hash(locator),
+	}
+	if stopHash != nil {
+		msg.HashStop = *stopHash
+	}
+	return msg
+}
+
+// NewMsgGetHeaders returns a new getheaders message populated with the block
+// locator and stop hash.
+func NewMsgGetHeaders(locator BlockLocator, stopHash *chainhash.Hash) *MsgGetHeaders {
+	msg := &MsgGetHeaders{
+		ProtocolVersion:    ProtocolVersion,
+		BlockLocatorHashes: []*chainhash.Hash(locator),
+	}
+	if stopHash != nil {
+		msg.HashStop = *stopHash
+	}
+	return msg
+}
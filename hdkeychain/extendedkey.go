@@ -0,0 +1,354 @@
+// Copyright (c) 2014-2015 Conformal Systems LLC.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Package hdkeychain implements BIP0032-style hierarchical deterministic
+// extended keys on top of btcwire's hashing primitives.
+package hdkeychain
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"math/big"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcutil/base58"
+	"github.com/h00gs/btcwire/chainhash"
+)
+
+const (
+	// RecommendedSeedLen is the recommended length in bytes for a seed
+	// to a master node.
+	RecommendedSeedLen = 32 // 256 bits
+
+	// HardenedKeyStart is the index at which a hardened key starts.  Each
+	// extended key has 2^31 normal child keys and 2^31 hardened child
+	// keys.  Thus the range for normal child keys is [0, 2^31 - 1] and the
+	// range for hardened child keys is [2^31, 2^32 - 1].
+	HardenedKeyStart = 0x80000000 // 2^31
+
+	// MinSeedBytes is the minimum number of bytes allowed for a seed to
+	// a master node.
+	MinSeedBytes = 16 // 128 bits
+
+	// MaxSeedBytes is the maximum number of bytes allowed for a seed to
+	// a master node.
+	MaxSeedBytes = 64 // 512 bits
+
+	// serializedKeyLen is the length of a serialized public or private
+	// extended key.  It consists of 4 bytes version, 1 byte depth, 4
+	// bytes parent fingerprint, 4 bytes child number, 32 bytes chain
+	// code, and 33 bytes of key data.
+	serializedKeyLen = 4 + 1 + 4 + 4 + 32 + 33
+)
+
+var (
+	// ErrDeriveHardFromPublic describes an error in which the caller
+	// attempted to derive a hardened extended key from a public key.
+	ErrDeriveHardFromPublic = errors.New("cannot derive a hardened key " +
+		"from a public key")
+
+	// ErrNotPrivExtKey describes an error in which the caller attempted
+	// to extract a private key from a public extended key.
+	ErrNotPrivExtKey = errors.New("unable to create private keys from " +
+		"a public extended key")
+
+	// ErrInvalidChild describes an error in which the child at a
+	// specific index is invalid, either because the resulting private
+	// key is zero or the resulting public key is the point at infinity.
+	// The extended key at this index should be skipped in favor of the
+	// next one, as permitted by BIP0032.
+	ErrInvalidChild = errors.New("the extended key at this index is invalid")
+
+	// ErrInvalidSeedLen describes an error in which the provided seed or
+	// seed length is not in the allowed range.
+	ErrInvalidSeedLen = errors.New("seed length must be between " +
+		"128 and 512 bits")
+
+	// ErrBadChecksum describes an error in which the checksum encoded
+	// with a serialized extended key does not match the calculated
+	// value.
+	ErrBadChecksum = errors.New("bad extended key checksum")
+
+	// ErrInvalidKeyLen describes an error in which the provided serialized
+	// key is not the expected length of 78 bytes.
+	ErrInvalidKeyLen = errors.New("the provided serialized extended key " +
+		"length is invalid")
+
+	// masterKey is the master key used along with a random seed used to
+	// generate the master node in the hierarchical tree.
+	masterKey = []byte("Bitcoin seed")
+)
+
+// ExtendedKey houses all the information needed to support a BIP0032
+// hierarchical deterministic extended key.
+type ExtendedKey struct {
+	net       *Params
+	key       []byte // This will be the bytes of a private or public key.
+	pubKey    []byte // This will only be set for private extended keys.
+	chainCode []byte
+	depth     uint8
+	parentFP  []byte
+	childNum  uint32
+	isPrivate bool
+}
+
+// newExtendedKey returns a new instance of an extended key with the given
+// fields.  No error checking is performed here as it's only intended to be
+// used internally as a convenience method.
+func newExtendedKey(net *Params, key, chainCode, parentFP []byte, depth uint8,
+	childNum uint32, isPrivate bool) *ExtendedKey {
+
+	return &ExtendedKey{
+		net:       net,
+		key:       key,
+		chainCode: chainCode,
+		depth:     depth,
+		parentFP:  parentFP,
+		childNum:  childNum,
+		isPrivate: isPrivate,
+	}
+}
+
+// pubKeyBytes returns bytes for the serialized compressed public key
+// associated with this extended key, deriving it from the private key if
+// necessary.
+func (k *ExtendedKey) pubKeyBytes() []byte {
+	if !k.isPrivate {
+		return k.key
+	}
+
+	if len(k.pubKey) == 0 {
+		privKey, _ := btcec.PrivKeyFromBytes(btcec.S256(), k.key)
+		k.pubKey = privKey.PubKey().SerializeCompressed()
+	}
+
+	return k.pubKey
+}
+
+// IsPrivate returns whether the extended key is a private extended key.
+func (k *ExtendedKey) IsPrivate() bool {
+	return k.isPrivate
+}
+
+// ParentFingerprint returns a fingerprint of the parent extended key from
+// which this one was derived.
+func (k *ExtendedKey) ParentFingerprint() uint32 {
+	return binary.BigEndian.Uint32(k.parentFP)
+}
+
+// Child returns a derived child extended key at the given index.  When this
+// extended key is a private extended key, a private extended key will be
+// derived.  Otherwise, the derived extended key will also be a public key.
+//
+// When the index is greater than or equal to HardenedKeyStart, the derived
+// extended key will be a hardened extended key.  It is only possible to
+// derive a hardened extended key from a private extended key, so an error
+// is returned when this is not the case.
+//
+// NOTE: There is an extremely small chance (< 1 in 2^127) this will fail to
+// derive a usable child.  The error ErrInvalidChild will be returned if this
+// should occur, and the caller is expected to ignore the invalid child and
+// simply retry with the next index.
+func (k *ExtendedKey) Child(i uint32) (*ExtendedKey, error) {
+	isChildHardened := i >= HardenedKeyStart
+	if !k.isPrivate && isChildHardened {
+		return nil, ErrDeriveHardFromPublic
+	}
+
+	keyLen := 33
+	data := make([]byte, keyLen+4)
+	if isChildHardened {
+		copy(data[1:], k.key)
+	} else {
+		copy(data, k.pubKeyBytes())
+	}
+	binary.BigEndian.PutUint32(data[keyLen:], i)
+
+	hmac512 := hmac.New(sha512.New, k.chainCode)
+	hmac512.Write(data)
+	ilr := hmac512.Sum(nil)
+
+	il := ilr[:len(ilr)/2]
+	childChainCode := ilr[len(ilr)/2:]
+
+	ilNum := new(big.Int).SetBytes(il)
+	curveOrder := btcec.S256().N
+	if ilNum.Cmp(curveOrder) >= 0 || ilNum.Sign() == 0 {
+		return nil, ErrInvalidChild
+	}
+
+	var isPrivate bool
+	var childKey []byte
+	if k.isPrivate {
+		keyNum := new(big.Int).SetBytes(k.key)
+		ilNum.Add(ilNum, keyNum)
+		ilNum.Mod(ilNum, curveOrder)
+		if ilNum.Sign() == 0 {
+			return nil, ErrInvalidChild
+		}
+		childKey = ilNum.Bytes()
+		isPrivate = true
+	} else {
+		ilx, ily := btcec.S256().ScalarBaseMult(il)
+		if ilx.Sign() == 0 && ily.Sign() == 0 {
+			return nil, ErrInvalidChild
+		}
+
+		pubKey, err := btcec.ParsePubKey(k.key, btcec.S256())
+		if err != nil {
+			return nil, err
+		}
+		childX, childY := btcec.S256().Add(ilx, ily, pubKey.X, pubKey.Y)
+		if childX.Sign() == 0 && childY.Sign() == 0 {
+			return nil, ErrInvalidChild
+		}
+		pk := btcec.PublicKey{Curve: btcec.S256(), X: childX, Y: childY}
+		childKey = pk.SerializeCompressed()
+	}
+
+	if isPrivate {
+		childKey = paddedAppend(32, childKey)
+	}
+
+	parentFP := btcec.Hash160(k.pubKeyBytes())[:4]
+	return newExtendedKey(k.net, childKey, childChainCode,
+		parentFP, k.depth+1, i, isPrivate), nil
+}
+
+// Neuter returns a new extended public key from this extended private key.
+// The same extended key will be returned unaltered if it is already an
+// extended public key.
+func (k *ExtendedKey) Neuter() *ExtendedKey {
+	if !k.isPrivate {
+		return k
+	}
+
+	return newExtendedKey(k.net, k.pubKeyBytes(), k.chainCode, k.parentFP,
+		k.depth, k.childNum, false)
+}
+
+// paddedAppend returns a copy of the src byte slice with leading zero bytes
+// added as needed so that it is size bytes long, as BIP0032 private keys must
+// always be 32 bytes.
+func paddedAppend(size uint, src []byte) []byte {
+	dst := make([]byte, size-uint(len(src)), size)
+	return append(dst, src...)
+}
+
+// String returns the extended key as a base58-check encoded string using
+// the network-specific version bytes it was created with.
+func (k *ExtendedKey) String() string {
+	if len(k.key) == 0 {
+		return ""
+	}
+
+	var childNumBytes [4]byte
+	binary.BigEndian.PutUint32(childNumBytes[:], k.childNum)
+
+	serializedBytes := make([]byte, 0, serializedKeyLen+4)
+	if k.isPrivate {
+		serializedBytes = append(serializedBytes, k.net.HDPrivateKeyID[:]...)
+	} else {
+		serializedBytes = append(serializedBytes, k.net.HDPublicKeyID[:]...)
+	}
+	serializedBytes = append(serializedBytes, k.depth)
+	serializedBytes = append(serializedBytes, k.parentFP...)
+	serializedBytes = append(serializedBytes, childNumBytes[:]...)
+	serializedBytes = append(serializedBytes, k.chainCode...)
+	if k.isPrivate {
+		serializedBytes = append(serializedBytes, 0x00)
+		serializedBytes = append(serializedBytes, paddedAppend(32, k.key)...)
+	} else {
+		serializedBytes = append(serializedBytes, k.pubKeyBytes()...)
+	}
+
+	checkSum := chainhash.DoubleHashB(serializedBytes)[:4]
+	serializedBytes = append(serializedBytes, checkSum...)
+	return base58.Encode(serializedBytes)
+}
+
+// NewMaster creates a new master node for use in creating a hierarchical
+// deterministic key chain.  The seed must be between MinSeedBytes and
+// MaxSeedBytes bytes, and should be generated by GenerateSeed or an
+// equivalently strong random source.
+func NewMaster(seed []byte, net *Params) (*ExtendedKey, error) {
+	if len(seed) < MinSeedBytes || len(seed) > MaxSeedBytes {
+		return nil, ErrInvalidSeedLen
+	}
+
+	hmac512 := hmac.New(sha512.New, masterKey)
+	hmac512.Write(seed)
+	lr := hmac512.Sum(nil)
+
+	secretKey := lr[:len(lr)/2]
+	chainCode := lr[len(lr)/2:]
+
+	secretKeyNum := new(big.Int).SetBytes(secretKey)
+	if secretKeyNum.Cmp(btcec.S256().N) >= 0 || secretKeyNum.Sign() == 0 {
+		return nil, ErrInvalidChild
+	}
+
+	parentFP := []byte{0x00, 0x00, 0x00, 0x00}
+	return newExtendedKey(net, secretKey, chainCode, parentFP, 0, 0, true), nil
+}
+
+// GenerateSeed returns a cryptographically secure random seed usable with
+// NewMaster.  The length must be between MinSeedBytes and MaxSeedBytes.
+func GenerateSeed(length uint8) ([]byte, error) {
+	if length < MinSeedBytes || length > MaxSeedBytes {
+		return nil, ErrInvalidSeedLen
+	}
+
+	buf := make([]byte, length)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+
+	return buf, nil
+}
+
+// NewKeyFromString returns a new extended key instance from a base58-check
+// encoded extended key, validating it against the version bytes of net.
+func NewKeyFromString(key string, net *Params) (*ExtendedKey, error) {
+	decoded := base58.Decode(key)
+	if len(decoded) != serializedKeyLen+4 {
+		return nil, ErrInvalidKeyLen
+	}
+
+	payload := decoded[:len(decoded)-4]
+	checkSum := decoded[len(decoded)-4:]
+	expectedCheckSum := chainhash.DoubleHashB(payload)[:4]
+	if !bytes.Equal(checkSum, expectedCheckSum) {
+		return nil, ErrBadChecksum
+	}
+
+	version := payload[0:4]
+	depth := payload[4:5][0]
+	parentFP := payload[5:9]
+	childNum := binary.BigEndian.Uint32(payload[9:13])
+	chainCode := payload[13:45]
+	keyData := payload[45:78]
+
+	var isPrivate bool
+	switch {
+	case bytes.Equal(version, net.HDPrivateKeyID[:]):
+		isPrivate = true
+	case bytes.Equal(version, net.HDPublicKeyID[:]):
+		isPrivate = false
+	default:
+		return nil, errors.New("the extended key version bytes do not " +
+			"match the network")
+	}
+
+	if isPrivate {
+		keyData = keyData[1:]
+	}
+
+	return newExtendedKey(net, keyData, chainCode, parentFP, depth, childNum,
+		isPrivate), nil
+}
@@ -0,0 +1,28 @@
+// Copyright (c) 2015 Conformal Systems LLC.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package hdkeychain
+
+// Params supplies the network-specific version bytes an ExtendedKey is
+// serialized with.  Each field is the 4-byte prefix that, once base58-check
+// encoded, produces the familiar "xprv"/"xpub" (mainnet) or "tprv"/"tpub"
+// (testnet) string prefixes.
+type Params struct {
+	HDPrivateKeyID [4]byte
+	HDPublicKeyID  [4]byte
+}
+
+// MainNetParams are the version bytes used for mainnet extended keys,
+// producing the standard xprv/xpub string prefixes.
+var MainNetParams = Params{
+	HDPrivateKeyID: [4]byte{0x04, 0x88, 0xad, 0xe4}, // xprv
+	HDPublicKeyID:  [4]byte{0x04, 0x88, 0xb2, 0x1e}, // xpub
+}
+
+// TestNetParams are the version bytes used for testnet extended keys,
+// producing the standard tprv/tpub string prefixes.
+var TestNetParams = Params{
+	HDPrivateKeyID: [4]byte{0x04, 0x35, 0x83, 0x94}, // tprv
+	HDPublicKeyID:  [4]byte{0x04, 0x35, 0x87, 0xcf}, // tpub
+}